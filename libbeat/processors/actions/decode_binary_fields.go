@@ -0,0 +1,411 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+const decodeBinaryFieldsName = "decode_binary_fields"
+
+type binaryFormat string
+
+const (
+	formatCBOR     binaryFormat = "cbor"
+	formatMsgpack  binaryFormat = "msgpack"
+	formatProtobuf binaryFormat = "protobuf"
+)
+
+type decodeBinaryFieldsConfig struct {
+	Format         binaryFormat `config:"format" validate:"required"`
+	Fields         []string     `config:"fields" validate:"required"`
+	Target         string       `config:"target"`
+	MaxDepth       int          `config:"max_depth"`
+	DescriptorFile string       `config:"descriptor_file"`
+	MessageType    string       `config:"message_type"`
+}
+
+func defaultDecodeBinaryFieldsConfig() decodeBinaryFieldsConfig {
+	return decodeBinaryFieldsConfig{
+		// 0 disables the max_depth check (see truncateDepth): nested
+		// structures are exactly what CBOR, MessagePack and Protobuf are
+		// for, so requiring depth to be raised just to decode an ordinary
+		// payload would be a bad default.
+		MaxDepth: 0,
+	}
+}
+
+// decodeBinaryFields decodes one or more CBOR, MessagePack or Protobuf
+// encoded fields into structured data, the binary counterpart of
+// decode_json_fields.
+type decodeBinaryFields struct {
+	config      decodeBinaryFieldsConfig
+	messageDesc protoreflect.MessageDescriptor
+}
+
+func init() {
+	processors.RegisterPlugin(decodeBinaryFieldsName, NewDecodeBinaryFields)
+}
+
+// NewDecodeBinaryFields constructs a new decode_binary_fields processor from
+// config.
+func NewDecodeBinaryFields(c *common.Config) (processors.Processor, error) {
+	config := defaultDecodeBinaryFieldsConfig()
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %s configuration: %w", decodeBinaryFieldsName, err)
+	}
+
+	p := &decodeBinaryFields{config: config}
+
+	switch config.Format {
+	case formatCBOR, formatMsgpack:
+	case formatProtobuf:
+		desc, err := loadMessageDescriptor(config.DescriptorFile, config.MessageType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", decodeBinaryFieldsName, err)
+		}
+		p.messageDesc = desc
+	default:
+		return nil, fmt.Errorf("%s: unsupported format %q", decodeBinaryFieldsName, config.Format)
+	}
+
+	return p, nil
+}
+
+func loadMessageDescriptor(descriptorFile, messageType string) (protoreflect.MessageDescriptor, error) {
+	if descriptorFile == "" || messageType == "" {
+		return nil, fmt.Errorf("protobuf format requires descriptor_file and message_type")
+	}
+
+	raw, err := os.ReadFile(descriptorFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading descriptor_file %q: %w", descriptorFile, err)
+	}
+
+	var fdset descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &fdset); err != nil {
+		return nil, fmt.Errorf("parsing descriptor_file %q: %w", descriptorFile, err)
+	}
+
+	files, err := protodesc.NewFiles(&fdset)
+	if err != nil {
+		return nil, fmt.Errorf("building file registry from %q: %w", descriptorFile, err)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(messageType))
+	if err != nil {
+		return nil, fmt.Errorf("message type %q not found in %q: %w", messageType, descriptorFile, err)
+	}
+
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message type", messageType)
+	}
+	return msgDesc, nil
+}
+
+func (f *decodeBinaryFields) Run(event *beat.Event) (*beat.Event, error) {
+	m, writeback, err := getMapStrFields(event)
+	if err != nil {
+		return event, err
+	}
+
+	var errs []string
+	for _, field := range f.config.Fields {
+		value, err := m.GetValue(field)
+		if err != nil {
+			continue
+		}
+
+		raw, err := toBytes(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", field, err))
+			continue
+		}
+
+		decoded, err := f.decode(raw)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("decoding field %s as %s: %v", field, f.config.Format, err))
+			continue
+		}
+
+		target := field
+		if f.config.Target != "" {
+			target = f.config.Target
+		}
+		if _, err := m.Put(target, decoded); err != nil {
+			errs = append(errs, fmt.Sprintf("setting target %s: %v", target, err))
+		}
+	}
+
+	if err := writeback(m); err != nil {
+		return event, err
+	}
+
+	if len(errs) > 0 {
+		return event, fmt.Errorf("%s: %v", decodeBinaryFieldsName, errs)
+	}
+	return event, nil
+}
+
+// toBytes returns the raw bytes to decode for value, base64-decoding it
+// first when it's a string, since binary payloads are commonly carried as
+// base64 text fields.
+func toBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		raw, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("base64 decoding: %w", err)
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("expected string or []byte, got %T", value)
+	}
+}
+
+func (f *decodeBinaryFields) decode(raw []byte) (interface{}, error) {
+	var out interface{}
+	var err error
+
+	switch f.config.Format {
+	case formatCBOR:
+		var v interface{}
+		if err = cbor.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		out = v
+	case formatMsgpack:
+		// msgpack.Unmarshal only decodes a single leading value and doesn't
+		// complain about trailing bytes, so a truncated or garbage payload
+		// can decode "successfully" into whatever its first byte happens to
+		// mean. Decode from a reader instead and require it to consume the
+		// whole input.
+		reader := bytes.NewReader(raw)
+		var v interface{}
+		if err = msgpack.NewDecoder(reader).Decode(&v); err != nil {
+			return nil, err
+		}
+		if reader.Len() > 0 {
+			return nil, fmt.Errorf("%d trailing byte(s) after msgpack value", reader.Len())
+		}
+		out = v
+	case formatProtobuf:
+		msg := dynamicpb.NewMessage(f.messageDesc)
+		if err = proto.Unmarshal(raw, msg); err != nil {
+			return nil, err
+		}
+		js, err := protojson.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(js))
+		dec.UseNumber()
+		if err := dec.Decode(&out); err != nil {
+			return nil, err
+		}
+		// protojson renders int64/uint64 (and the fixed/sint64 variants) as
+		// quoted strings, per the canonical proto3 JSON mapping, so they
+		// don't lose precision in JS consumers. Unquote them here, keyed off
+		// the message descriptor, so normalizeNumerics below sees the same
+		// int64 it would for CBOR/MessagePack.
+		out = unquoteProtoInt64Fields(out, f.messageDesc)
+	}
+
+	out, err = truncateDepth(normalizeNumerics(out), f.config.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unquoteProtoInt64Fields walks v -- the result of decoding a protojson
+// message with json.Number enabled -- alongside desc, and replaces the
+// quoted string protojson uses for 64-bit integer fields with the parsed
+// number, so normalizeNumerics can treat it the same as any other integer.
+// v is expected to be a map[string]interface{}, or nil/non-map if desc has
+// no corresponding value (e.g. a field that was omitted because it's unset).
+func unquoteProtoInt64Fields(v interface{}, desc protoreflect.MessageDescriptor) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok || desc == nil {
+		return v
+	}
+
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		key := fd.JSONName()
+		if val, ok := m[key]; ok {
+			m[key] = unquoteProtoFieldValue(val, fd)
+		}
+	}
+	return m
+}
+
+// unquoteProtoFieldValue applies unquoteProtoInt64Fields' unquoting to a
+// single field's value, recursing into nested messages and repeated fields.
+func unquoteProtoFieldValue(val interface{}, fd protoreflect.FieldDescriptor) interface{} {
+	if list, ok := val.([]interface{}); ok && fd.IsList() {
+		for i, e := range list {
+			list[i] = unquoteProtoScalar(e, fd)
+		}
+		return list
+	}
+	return unquoteProtoScalar(val, fd)
+}
+
+func unquoteProtoScalar(val interface{}, fd protoreflect.FieldDescriptor) interface{} {
+	if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		return unquoteProtoInt64Fields(val, fd.Message())
+	}
+
+	s, ok := val.(string)
+	if !ok || !is64BitIntKind(fd.Kind()) {
+		return val
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(i, 10))
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return json.Number(strconv.FormatUint(u, 10))
+	}
+	return val
+}
+
+func is64BitIntKind(k protoreflect.Kind) bool {
+	switch k {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	default:
+		return false
+	}
+}
+
+// normalizeNumerics walks a decoded value and converts integer and floating
+// point types produced by the CBOR/MessagePack/Protobuf codecs to int64 and
+// float64 respectively, matching the types encoding/json produces so that
+// decoded fields behave the same regardless of source format.
+func normalizeNumerics(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, e := range val {
+			val[k] = normalizeNumerics(e)
+		}
+		return val
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			m[fmt.Sprintf("%v", k)] = normalizeNumerics(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range val {
+			val[i] = normalizeNumerics(e)
+		}
+		return val
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return toInt64(val)
+	case float32:
+		return float64(val)
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	default:
+		return val
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case uint:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	}
+	return 0
+}
+
+// truncateDepth limits v to maxDepth levels of nested maps/slices. maxDepth
+// <= 0 disables the check. A structure deeper than maxDepth is an error
+// rather than being silently truncated, so callers don't get surprised by
+// missing data.
+func truncateDepth(v interface{}, maxDepth int) (interface{}, error) {
+	if maxDepth <= 0 {
+		return v, nil
+	}
+	return checkDepth(v, maxDepth)
+}
+
+func checkDepth(v interface{}, remaining int) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if remaining <= 0 {
+			return nil, fmt.Errorf("exceeds max_depth")
+		}
+		for k, e := range val {
+			child, err := checkDepth(e, remaining-1)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = child
+		}
+		return val, nil
+	case []interface{}:
+		if remaining <= 0 {
+			return nil, fmt.Errorf("exceeds max_depth")
+		}
+		for i, e := range val {
+			child, err := checkDepth(e, remaining-1)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = child
+		}
+		return val, nil
+	default:
+		return val, nil
+	}
+}
+
+func (f *decodeBinaryFields) String() string {
+	return fmt.Sprintf("%s=(format=%s, fields=%v, target=%s)",
+		decodeBinaryFieldsName, f.config.Format, f.config.Fields, f.config.Target)
+}
@@ -0,0 +1,270 @@
+package actions
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// testProtoMessageType is the fully-qualified name of the message described
+// by newTestMessageDescriptor. newTestMessageDescriptor looks the message up
+// by this name, and TestDecodeBinaryFieldsProtobufDescriptorFile passes it as
+// message_type when loading the descriptor from descriptor_file.
+const testProtoMessageType = "actionstest.BinaryTestMessage"
+
+// newTestMessageDescriptor builds, in memory, the descriptor for a message
+// with a string "user" field and an int64 "age" field -- the same shape as
+// the CBOR/MessagePack payload in TestDecodeBinaryFieldsRoundTrip below -- so
+// tests don't depend on a
+// protoc-generated .pb.go file.
+func newTestMessageDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("actionstest/binary_test_message.proto"),
+		Package: proto.String("actionstest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("BinaryTestMessage"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("user"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("user"),
+				},
+				{
+					Name:     proto.String("age"),
+					Number:   proto.Int32(2),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("age"),
+				},
+			},
+		}},
+	}
+
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fd}})
+	require.NoError(t, err)
+
+	desc, err := files.FindDescriptorByName(testProtoMessageType)
+	require.NoError(t, err)
+
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	require.True(t, ok)
+	return msgDesc
+}
+
+// marshalTestProtoMessage encodes user/age as a BinaryTestMessage.
+func marshalTestProtoMessage(t *testing.T, msgDesc protoreflect.MessageDescriptor, user string, age int64) []byte {
+	t.Helper()
+
+	msg := dynamicpb.NewMessage(msgDesc)
+	msg.Set(msgDesc.Fields().ByName("user"), protoreflect.ValueOfString(user))
+	msg.Set(msgDesc.Fields().ByName("age"), protoreflect.ValueOfInt64(age))
+
+	raw, err := proto.Marshal(msg)
+	require.NoError(t, err)
+	return raw
+}
+
+func TestDecodeBinaryFieldsRoundTrip(t *testing.T) {
+	payload := map[string]interface{}{
+		"user": "alice",
+		"age":  int64(30),
+	}
+	msgDesc := newTestMessageDescriptor(t)
+
+	cases := []struct {
+		name        string
+		format      binaryFormat
+		messageDesc protoreflect.MessageDescriptor
+		encoded     []byte
+	}{
+		{
+			name:   "cbor",
+			format: formatCBOR,
+			encoded: func() []byte {
+				b, err := cbor.Marshal(payload)
+				require.NoError(t, err)
+				return b
+			}(),
+		},
+		{
+			name:   "msgpack",
+			format: formatMsgpack,
+			encoded: func() []byte {
+				b, err := msgpack.Marshal(payload)
+				require.NoError(t, err)
+				return b
+			}(),
+		},
+		{
+			name:        "protobuf",
+			format:      formatProtobuf,
+			messageDesc: msgDesc,
+			encoded:     marshalTestProtoMessage(t, msgDesc, "alice", 30),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &decodeBinaryFields{
+				config: decodeBinaryFieldsConfig{
+					Format:   c.format,
+					Fields:   []string{"raw"},
+					Target:   "decoded",
+					MaxDepth: 2,
+				},
+				messageDesc: c.messageDesc,
+			}
+
+			event := &beat.Event{Fields: common.MapStr{
+				"raw": base64.StdEncoding.EncodeToString(c.encoded),
+			}}
+
+			out, err := p.Run(event)
+			require.NoError(t, err)
+
+			decoded, err := out.Fields.(common.MapStr).GetValue("decoded")
+			require.NoError(t, err)
+
+			m, ok := decoded.(map[string]interface{})
+			require.True(t, ok, "decoded value should be map[string]interface{}, got %T", decoded)
+			assert.Equal(t, "alice", m["user"])
+			assert.Equal(t, int64(30), m["age"])
+		})
+	}
+}
+
+// TestDecodeBinaryFieldsProtobufDescriptorFile exercises the
+// descriptor_file/message_type config path end to end, via
+// NewDecodeBinaryFields rather than constructing the processor directly.
+func TestDecodeBinaryFieldsProtobufDescriptorFile(t *testing.T) {
+	msgDesc := newTestMessageDescriptor(t)
+	fdset := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(msgDesc.ParentFile()),
+	}}
+	raw, err := proto.Marshal(fdset)
+	require.NoError(t, err)
+
+	descriptorFile := filepath.Join(t.TempDir(), "descriptor.pb")
+	require.NoError(t, os.WriteFile(descriptorFile, raw, 0o600))
+
+	cfg, err := common.NewConfigFrom(map[string]interface{}{
+		"format":          "protobuf",
+		"fields":          []string{"raw"},
+		"target":          "decoded",
+		"descriptor_file": descriptorFile,
+		"message_type":    testProtoMessageType,
+	})
+	require.NoError(t, err)
+
+	proc, err := NewDecodeBinaryFields(cfg)
+	require.NoError(t, err)
+
+	event := &beat.Event{Fields: common.MapStr{
+		"raw": base64.StdEncoding.EncodeToString(marshalTestProtoMessage(t, msgDesc, "bob", 42)),
+	}}
+
+	out, err := proc.Run(event)
+	require.NoError(t, err)
+
+	decoded, err := out.Fields.(common.MapStr).GetValue("decoded")
+	require.NoError(t, err)
+	m, ok := decoded.(map[string]interface{})
+	require.True(t, ok, "decoded value should be map[string]interface{}, got %T", decoded)
+	assert.Equal(t, "bob", m["user"])
+	assert.Equal(t, int64(42), m["age"])
+}
+
+func TestDecodeBinaryFieldsMalformedPayload(t *testing.T) {
+	msgDesc := newTestMessageDescriptor(t)
+
+	cases := []struct {
+		name        string
+		format      binaryFormat
+		messageDesc protoreflect.MessageDescriptor
+		raw         []byte
+	}{
+		{name: "cbor", format: formatCBOR, raw: []byte("not a valid payload")},
+		{name: "msgpack", format: formatMsgpack, raw: []byte("not a valid payload")},
+		// 0xff starts a multi-byte varint tag with no continuation bytes,
+		// which is truncated/invalid protobuf wire format.
+		{name: "protobuf", format: formatProtobuf, messageDesc: msgDesc, raw: []byte{0xff}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &decodeBinaryFields{
+				config: decodeBinaryFieldsConfig{
+					Format:   c.format,
+					Fields:   []string{"raw"},
+					MaxDepth: 1,
+				},
+				messageDesc: c.messageDesc,
+			}
+
+			event := &beat.Event{Fields: common.MapStr{
+				"raw": base64.StdEncoding.EncodeToString(c.raw),
+			}}
+
+			_, err := p.Run(event)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDecodeBinaryFieldsNotBase64(t *testing.T) {
+	p := &decodeBinaryFields{config: decodeBinaryFieldsConfig{
+		Format:   formatCBOR,
+		Fields:   []string{"raw"},
+		MaxDepth: 1,
+	}}
+
+	event := &beat.Event{Fields: common.MapStr{
+		"raw": "!!!not-base64!!!",
+	}}
+
+	_, err := p.Run(event)
+	assert.Error(t, err)
+}
+
+func TestDecodeBinaryFieldsMaxDepth(t *testing.T) {
+	payload := map[string]interface{}{
+		"outer": map[string]interface{}{
+			"inner": "too deep",
+		},
+	}
+	b, err := cbor.Marshal(payload)
+	require.NoError(t, err)
+
+	p := &decodeBinaryFields{config: decodeBinaryFieldsConfig{
+		Format:   formatCBOR,
+		Fields:   []string{"raw"},
+		Target:   "decoded",
+		MaxDepth: 1,
+	}}
+
+	event := &beat.Event{Fields: common.MapStr{
+		"raw": base64.StdEncoding.EncodeToString(b),
+	}}
+
+	_, err = p.Run(event)
+	assert.Error(t, err, "a structure nested deeper than max_depth should error")
+}
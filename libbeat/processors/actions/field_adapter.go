@@ -0,0 +1,83 @@
+package actions
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// EventFieldsAdapter lets action processors operate on beat.Event values
+// whose Fields aren't a common.MapStr, for example a struct decoded from a
+// custom input's API response. AsMapStr converts fields to a common.MapStr
+// for a processor to read and mutate, and returns a writeback function that
+// applies any mutations made to that MapStr back onto fields.
+type EventFieldsAdapter interface {
+	AsMapStr(fields interface{}) (common.MapStr, func(common.MapStr) error, error)
+}
+
+// fieldsAdapters holds adapters registered for a concrete Fields type, keyed
+// by that type. Types without a registered adapter fall back to
+// structFieldsAdapter.
+var fieldsAdapters = map[reflect.Type]EventFieldsAdapter{}
+
+// RegisterFieldsAdapter registers adapter to be used by getMapStrFields
+// whenever a beat.Event's Fields holds a value of the same type as sample.
+// It is intended to be called from a beat's or input's init function, before
+// any processors run.
+func RegisterFieldsAdapter(sample interface{}, adapter EventFieldsAdapter) {
+	fieldsAdapters[reflect.TypeOf(sample)] = adapter
+}
+
+// structFieldsAdapter is the fallback EventFieldsAdapter used for any Fields
+// type that hasn't registered its own adapter. It round-trips through
+// mapstructure: decoding fields into a common.MapStr up front, and decoding
+// the (possibly mutated) MapStr back into a fresh value of the same concrete
+// type on writeback.
+//
+// Unlike a custom EventFieldsAdapter, which is written against a known
+// concrete type and can mutate it however it likes, structFieldsAdapter has
+// to work for whatever struct a beat happens to store in event.Fields --
+// usually held by value, not by pointer, since that's how a typed API
+// response is normally unmarshalled. mapstructure can only decode into an
+// addressable destination, so structFieldsAdapter takes a pointer to the
+// event's Fields slot (fieldsPtr, a *interface{}) rather than the Fields
+// value itself, builds a new addressable instance of the same concrete type
+// for mapstructure to decode into, and swaps it into *fieldsPtr on a
+// successful writeback.
+type structFieldsAdapter struct{}
+
+func (structFieldsAdapter) AsMapStr(fieldsPtr interface{}) (common.MapStr, func(common.MapStr) error, error) {
+	ptr := reflect.ValueOf(fieldsPtr)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Interface {
+		return nil, nil, fmt.Errorf("internal error: structFieldsAdapter requires a *interface{}, got %T", fieldsPtr)
+	}
+	original := ptr.Elem().Elem() // the concrete value held by *fieldsPtr
+	if !original.IsValid() {
+		return nil, nil, fmt.Errorf("event.Fields is nil")
+	}
+
+	m := common.MapStr{}
+	if err := mapstructure.Decode(original.Interface(), &m); err != nil {
+		return nil, nil, fmt.Errorf("converting %T to common.MapStr: %w", original.Interface(), err)
+	}
+
+	writeback := func(updated common.MapStr) error {
+		newValue := reflect.New(original.Type())
+		dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			Result:           newValue.Interface(),
+			WeaklyTypedInput: true,
+		})
+		if err != nil {
+			return err
+		}
+		if err := dec.Decode(map[string]interface{}(updated)); err != nil {
+			return err
+		}
+		ptr.Elem().Set(newValue.Elem())
+		return nil
+	}
+	return m, writeback, nil
+}
@@ -0,0 +1,85 @@
+package actions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+type customTypedFields struct {
+	User string
+	Age  int64
+}
+
+type customFieldsAdapter struct{}
+
+func (customFieldsAdapter) AsMapStr(fields interface{}) (common.MapStr, func(common.MapStr) error, error) {
+	f, ok := fields.(customTypedFields)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected customTypedFields, got %T", fields)
+	}
+	m := common.MapStr{"user": f.User, "age": f.Age}
+	return m, func(common.MapStr) error {
+		return fmt.Errorf("writeback not supported by customFieldsAdapter")
+	}, nil
+}
+
+func TestGetMapStrFieldsMapStrPassthrough(t *testing.T) {
+	event := &beat.Event{Fields: common.MapStr{"user": "alice"}}
+
+	m, writeback, err := getMapStrFields(event)
+	require.NoError(t, err)
+
+	m["age"] = int64(30)
+	require.NoError(t, writeback(m))
+
+	assert.Equal(t, common.MapStr{"user": "alice", "age": int64(30)}, event.Fields)
+}
+
+func TestGetMapStrFieldsRegisteredAdapter(t *testing.T) {
+	RegisterFieldsAdapter(customTypedFields{}, customFieldsAdapter{})
+
+	event := &beat.Event{Fields: customTypedFields{User: "bob", Age: 42}}
+
+	m, _, err := getMapStrFields(event)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", m["user"])
+	assert.Equal(t, int64(42), m["age"])
+}
+
+// TestGetMapStrFieldsFallbackByValue exercises the regression this fixes: a
+// typed struct held by value in event.Fields (the common case for a beat
+// that unmarshals a typed API response), with no adapter registered for its
+// type, must still support writeback.
+func TestGetMapStrFieldsFallbackByValue(t *testing.T) {
+	type icingaStatus struct {
+		Host  string
+		State int64
+	}
+
+	event := &beat.Event{Fields: icingaStatus{Host: "web01", State: 0}}
+
+	m, writeback, err := getMapStrFields(event)
+	require.NoError(t, err)
+	assert.Equal(t, "web01", m["Host"])
+	assert.Equal(t, int64(0), m["State"])
+
+	m["State"] = int64(2)
+	require.NoError(t, writeback(m))
+
+	updated, ok := event.Fields.(icingaStatus)
+	require.True(t, ok, "event.Fields should still be an icingaStatus, got %T", event.Fields)
+	assert.Equal(t, icingaStatus{Host: "web01", State: 2}, updated)
+}
+
+func TestGetMapStrFieldsFallbackNilFields(t *testing.T) {
+	event := &beat.Event{Fields: nil}
+
+	_, _, err := getMapStrFields(event)
+	assert.Error(t, err)
+}
@@ -2,15 +2,46 @@ package actions
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 )
 
-func getMapStrFields(e *beat.Event) (common.MapStr, error) {
-	m, ok := e.Fields.(common.MapStr)
-	if !ok {
-		return nil, fmt.Errorf("common.MapStr required, but got %T", e.Fields)
+// getMapStrFields returns event's Fields as a common.MapStr, along with a
+// writeback function that must be called with the (possibly mutated) result
+// to propagate changes back to event. When event.Fields is already a
+// common.MapStr this is a direct passthrough; otherwise it goes through the
+// EventFieldsAdapter registered for event.Fields' concrete type, or
+// structFieldsAdapter if none was registered.
+//
+// Action processors (drop_fields, rename, copy_fields, decode_json_fields,
+// and friends) should call this instead of asserting Fields is a
+// common.MapStr directly, so that they also work against beats and inputs
+// that keep their event fields in a typed struct.
+func getMapStrFields(e *beat.Event) (common.MapStr, func(common.MapStr) error, error) {
+	if m, ok := e.Fields.(common.MapStr); ok {
+		return m, func(updated common.MapStr) error {
+			e.Fields = updated
+			return nil
+		}, nil
 	}
-	return m, nil
+
+	if adapter, ok := fieldsAdapters[reflect.TypeOf(e.Fields)]; ok {
+		m, writeback, err := adapter.AsMapStr(e.Fields)
+		if err != nil {
+			return nil, nil, fmt.Errorf("common.MapStr required, but got %T: %w", e.Fields, err)
+		}
+		return m, writeback, nil
+	}
+
+	// No adapter was registered for this concrete type: fall back to
+	// mapstructure-based round-tripping. Unlike a registered adapter, the
+	// fallback needs a pointer to the Fields slot itself (not just its
+	// current value) so it can swap in a freshly decoded value on writeback.
+	m, writeback, err := structFieldsAdapter{}.AsMapStr(&e.Fields)
+	if err != nil {
+		return nil, nil, fmt.Errorf("common.MapStr required, but got %T: %w", e.Fields, err)
+	}
+	return m, writeback, nil
 }